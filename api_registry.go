@@ -0,0 +1,202 @@
+package service_proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+func mergeStringMaps(base, overrides map[string]string) map[string]string {
+	if base == nil && overrides == nil {
+		return nil
+	}
+
+	merged := make(map[string]string, len(base)+len(overrides))
+	for key, val := range base {
+		merged[key] = val
+	}
+	for key, val := range overrides {
+		merged[key] = val
+	}
+	return merged
+}
+
+// validatePathParams checks that params supplies exactly the names declared in api.PathParams
+// (no missing, no unknown) and, when declared, that each value matches its
+// api.PathParamPatterns regexp.
+func validatePathParams(api *ServiceApi, params map[string]string) error {
+	declared := make(map[string]bool, len(api.PathParams))
+
+	for _, name := range api.PathParams {
+		declared[name] = true
+
+		val, ok := params[name]
+		if !ok || val == "" {
+			return errors.New(fmt.Sprintf("Missing path param %q for %s", name, api.Path))
+		}
+
+		if pattern, ok := api.PathParamPatterns[name]; ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return errors.New(fmt.Sprintf("Invalid path param pattern for %q: %v", name, err))
+			}
+			if !re.MatchString(val) {
+				return errors.New(fmt.Sprintf("Path param %q value %q does not match pattern %q", name, val, pattern))
+			}
+		}
+	}
+
+	for name := range params {
+		if !declared[name] {
+			return errors.New(fmt.Sprintf("Unknown path param %q for %s", name, api.Path))
+		}
+	}
+
+	return nil
+}
+
+func expandPathParams(path string, params map[string]string) string {
+	for name, val := range params {
+		path = strings.ReplaceAll(path, "{"+name+"}", val)
+	}
+	return path
+}
+
+// yamlAPIDefinition is the shape LoadAPIsFromYAML expects under each key of its top-level
+// "apis" map.
+type yamlAPIDefinition struct {
+	Method            string            `yaml:"method"`
+	Path              string            `yaml:"path"`
+	PathParams        []string          `yaml:"pathParams"`
+	PathParamPatterns map[string]string `yaml:"pathParamPatterns"`
+	RequestFormat     string            `yaml:"requestFormat"`
+	ResponseFormat    string            `yaml:"responseFormat"`
+	DefaultQuery      map[string]string `yaml:"defaultQuery"`
+	DefaultHeaders    map[string]string `yaml:"defaultHeaders"`
+}
+
+type yamlAPIsDocument struct {
+	APIs map[string]yamlAPIDefinition `yaml:"apis"`
+}
+
+// LoadAPIsFromYAML reads a declarative API registry in this package's own YAML shape (a top
+// level "apis" map of ServiceApi-like definitions, keyed the same way as
+// HTTPServiceProxyOptions.APIs) and returns it ready to pass to NewHTTPServiceProxy.
+func LoadAPIsFromYAML(r io.Reader) (map[string]ServiceApi, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yamlAPIsDocument
+	if err = yaml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to parse APIs YAML: %v", err))
+	}
+
+	apis := make(map[string]ServiceApi, len(doc.APIs))
+	for key, def := range doc.APIs {
+		apis[key] = ServiceApi{
+			Method:            def.Method,
+			Path:              def.Path,
+			PathParams:        def.PathParams,
+			PathParamPatterns: def.PathParamPatterns,
+			RequestFormat:     def.RequestFormat,
+			ResponseFormat:    def.ResponseFormat,
+			DefaultQuery:      def.DefaultQuery,
+			DefaultHeaders:    def.DefaultHeaders,
+		}
+	}
+
+	return apis, nil
+}
+
+type openAPIParameterSchema struct {
+	Pattern string `yaml:"pattern"`
+}
+
+type openAPIParameter struct {
+	Name   string                 `yaml:"name"`
+	In     string                 `yaml:"in"`
+	Schema openAPIParameterSchema `yaml:"schema"`
+}
+
+type openAPIOperation struct {
+	OperationId string             `yaml:"operationId"`
+	Parameters  []openAPIParameter `yaml:"parameters"`
+}
+
+// openAPIMethodKeys are the only keys of a Path Item Object that denote an Operation Object.
+// Everything else ("summary", "description", "servers", "parameters", "$ref", ...) is metadata
+// shared across the path's operations and must be skipped rather than decoded as one.
+var openAPIMethodKeys = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true,
+	"options": true, "head": true, "patch": true, "trace": true,
+}
+
+type openAPIDocument struct {
+	Paths map[string]map[string]yaml.Node `yaml:"paths"`
+}
+
+// LoadAPIsFromOpenAPI reads an OpenAPI 3 document (YAML, or JSON since JSON is valid YAML) and
+// derives a ServiceApi per operation, keyed by operationId when present or "METHOD /path"
+// otherwise. Path parameters are taken from "in: path" parameters; a "pattern" on the
+// parameter's schema becomes a PathParamPatterns entry.
+func LoadAPIsFromOpenAPI(r io.Reader) (map[string]ServiceApi, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc openAPIDocument
+	if err = yaml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.New(fmt.Sprintf("Failed to parse OpenAPI document: %v", err))
+	}
+
+	apis := make(map[string]ServiceApi)
+	for path, item := range doc.Paths {
+		for key, node := range item {
+			method := strings.ToLower(key)
+			if !openAPIMethodKeys[method] {
+				continue
+			}
+
+			var op openAPIOperation
+			if err = node.Decode(&op); err != nil {
+				return nil, errors.New(fmt.Sprintf("Failed to parse operation %s %s: %v", key, path, err))
+			}
+
+			apiKey := op.OperationId
+			if apiKey == "" {
+				apiKey = fmt.Sprintf("%s %s", strings.ToUpper(method), path)
+			}
+
+			api := ServiceApi{
+				Method: strings.ToUpper(method),
+				Path:   path,
+			}
+
+			for _, param := range op.Parameters {
+				if param.In != "path" {
+					continue
+				}
+
+				api.PathParams = append(api.PathParams, param.Name)
+				if param.Schema.Pattern != "" {
+					if api.PathParamPatterns == nil {
+						api.PathParamPatterns = make(map[string]string)
+					}
+					api.PathParamPatterns[param.Name] = param.Schema.Pattern
+				}
+			}
+
+			apis[apiKey] = api
+		}
+	}
+
+	return apis, nil
+}
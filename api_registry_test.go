@@ -0,0 +1,120 @@
+package service_proxy
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePathParams(t *testing.T) {
+	api := &ServiceApi{
+		Method:            "GET",
+		Path:              "/users/{id}/posts/{postId}",
+		PathParams:        []string{"id", "postId"},
+		PathParamPatterns: map[string]string{"id": `^\d+$`},
+	}
+
+	cases := []struct {
+		name    string
+		params  map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			params: map[string]string{"id": "42", "postId": "abc"},
+		},
+		{
+			name:    "missing param",
+			params:  map[string]string{"id": "42"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown param",
+			params:  map[string]string{"id": "42", "postId": "abc", "extra": "nope"},
+			wantErr: true,
+		},
+		{
+			name:    "pattern mismatch",
+			params:  map[string]string{"id": "not-a-number", "postId": "abc"},
+			wantErr: true,
+		},
+		{
+			name:    "empty value treated as missing",
+			params:  map[string]string{"id": "", "postId": "abc"},
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validatePathParams(api, c.params)
+			if c.wantErr && err == nil {
+				t.Fatalf("expected an error, got nil")
+			}
+			if !c.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestExpandPathParams(t *testing.T) {
+	got := expandPathParams("/users/{id}/posts/{postId}", map[string]string{"id": "42", "postId": "7"})
+	want := "/users/42/posts/7"
+	if got != want {
+		t.Fatalf("expandPathParams() = %q, want %q", got, want)
+	}
+}
+
+func TestLoadAPIsFromOpenAPISkipsNonOperationKeys(t *testing.T) {
+	doc := `
+paths:
+  /users/{id}:
+    summary: A shared summary
+    description: A shared description
+    servers:
+      - url: https://example.test
+    parameters:
+      - name: trace
+        in: header
+    get:
+      operationId: getUser
+      parameters:
+        - name: id
+          in: path
+          schema:
+            pattern: '^\d+$'
+    delete:
+      operationId: deleteUser
+`
+
+	apis, err := LoadAPIsFromOpenAPI(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(apis) != 2 {
+		t.Fatalf("expected 2 operations, got %d: %+v", len(apis), apis)
+	}
+
+	get, ok := apis["getUser"]
+	if !ok {
+		t.Fatalf("expected a %q entry, got %+v", "getUser", apis)
+	}
+	if get.Method != "GET" || get.Path != "/users/{id}" {
+		t.Fatalf("unexpected getUser entry: %+v", get)
+	}
+	if len(get.PathParams) != 1 || get.PathParams[0] != "id" {
+		t.Fatalf("expected PathParams [id], got %v", get.PathParams)
+	}
+	if get.PathParamPatterns["id"] != `^\d+$` {
+		t.Fatalf("expected id pattern, got %v", get.PathParamPatterns)
+	}
+
+	del, ok := apis["deleteUser"]
+	if !ok {
+		t.Fatalf("expected a %q entry, got %+v", "deleteUser", apis)
+	}
+	if del.Method != "DELETE" {
+		t.Fatalf("unexpected deleteUser entry: %+v", del)
+	}
+}
@@ -0,0 +1,65 @@
+package service_proxy
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// NewBearerTokenMiddleware builds a Middleware that attaches an "Authorization: Bearer <token>"
+// header using a token from tokenSource, caching it across calls and refreshing it whenever a
+// request comes back with 401.
+func NewBearerTokenMiddleware(tokenSource func(ctx context.Context) (string, error)) Middleware {
+	var (
+		mu    sync.Mutex
+		token string
+	)
+
+	fetch := func(ctx context.Context, forceRefresh bool) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if token != "" && !forceRefresh {
+			return token, nil
+		}
+
+		t, err := tokenSource(ctx)
+		if err != nil {
+			return "", err
+		}
+		token = t
+		return token, nil
+	}
+
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			t, err := fetch(req.Context(), false)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", "Bearer "+t)
+
+			res, err := next(req)
+			if err != nil || res == nil || res.StatusCode != http.StatusUnauthorized {
+				return res, err
+			}
+
+			t, err = fetch(req.Context(), true)
+			if err != nil {
+				// Can't refresh - hand back the original 401 response as-is.
+				return res, nil
+			}
+			_ = res.Body.Close()
+
+			if req.GetBody != nil {
+				rc, getErr := req.GetBody()
+				if getErr == nil {
+					req.Body = rc
+				}
+			}
+			req.Header.Set("Authorization", "Bearer "+t)
+
+			return next(req)
+		}
+	}
+}
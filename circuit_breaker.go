@@ -0,0 +1,70 @@
+package service_proxy
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by a NewCircuitBreaker middleware instead of performing the call
+// while the circuit for that API key is open.
+var ErrCircuitOpen = errors.New("service-proxy: circuit open")
+
+type circuitBreakerState struct {
+	mu              sync.Mutex
+	consecutiveFail int
+	openUntil       time.Time
+}
+
+// NewCircuitBreaker builds a Middleware that tracks consecutive failures per ServiceApi key
+// (via ApiKeyFromContext). Once threshold consecutive failures are seen, the circuit opens and
+// short-circuits with ErrCircuitOpen for cooldown before allowing another attempt through. A
+// transport error or a 5xx response counts as a failure; anything else resets the counter.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) Middleware {
+	var (
+		mu     sync.Mutex
+		states = make(map[string]*circuitBreakerState)
+	)
+
+	stateFor := func(key string) *circuitBreakerState {
+		mu.Lock()
+		defer mu.Unlock()
+
+		s, ok := states[key]
+		if !ok {
+			s = &circuitBreakerState{}
+			states[key] = s
+		}
+		return s
+	}
+
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			key, _ := ApiKeyFromContext(req.Context())
+			s := stateFor(key)
+
+			s.mu.Lock()
+			if s.consecutiveFail >= threshold && time.Now().Before(s.openUntil) {
+				s.mu.Unlock()
+				return nil, ErrCircuitOpen
+			}
+			s.mu.Unlock()
+
+			res, err := next(req)
+
+			s.mu.Lock()
+			if err != nil || (res != nil && res.StatusCode >= 500) {
+				s.consecutiveFail++
+				if s.consecutiveFail >= threshold {
+					s.openUntil = time.Now().Add(cooldown)
+				}
+			} else {
+				s.consecutiveFail = 0
+			}
+			s.mu.Unlock()
+
+			return res, err
+		}
+	}
+}
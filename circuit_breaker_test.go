@@ -0,0 +1,103 @@
+package service_proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	failing := func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("boom")
+	}
+
+	breaker := NewCircuitBreaker(2, 50*time.Millisecond)
+	rt := breaker(failing)
+
+	ctx := context.WithValue(context.Background(), apiKeyContextKey{}, "svc")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.test", nil)
+
+	// First two failures accumulate but still hit the underlying round tripper.
+	if _, err := rt(req); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("attempt 1: expected underlying error, got %v", err)
+	}
+	if _, err := rt(req); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("attempt 2: expected underlying error, got %v", err)
+	}
+
+	// Circuit is now open: further calls short-circuit without reaching failing.
+	if _, err := rt(req); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("attempt 3: expected ErrCircuitOpen, got %v", err)
+	}
+}
+
+func TestNewCircuitBreakerHalfOpenAfterCooldown(t *testing.T) {
+	var shouldFail = true
+	flaky := func(req *http.Request) (*http.Response, error) {
+		if shouldFail {
+			return nil, errors.New("boom")
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	}
+
+	cooldown := 30 * time.Millisecond
+	breaker := NewCircuitBreaker(1, cooldown)
+	rt := breaker(flaky)
+
+	ctx := context.WithValue(context.Background(), apiKeyContextKey{}, "svc")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.test", nil)
+
+	if _, err := rt(req); err == nil {
+		t.Fatal("expected the first call to fail")
+	}
+	if _, err := rt(req); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected circuit to be open immediately after tripping, got %v", err)
+	}
+
+	time.Sleep(cooldown * 2)
+	shouldFail = false
+
+	res, err := rt(req)
+	if err != nil {
+		t.Fatalf("expected cooldown to let the call back through, got %v", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", res.StatusCode)
+	}
+
+	// A success resets the failure count; with a threshold of 1, a single subsequent failure trips
+	// it again.
+	shouldFail = true
+	if _, err = rt(req); err == nil {
+		t.Fatal("expected this call to fail")
+	}
+	if _, err = rt(req); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the breaker to trip again after one failure post-reset, got %v", err)
+	}
+}
+
+func TestNewCircuitBreakerKeysStatePerApi(t *testing.T) {
+	failing := func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("boom")
+	}
+
+	breaker := NewCircuitBreaker(1, time.Hour)
+	rt := breaker(failing)
+
+	ctxA := context.WithValue(context.Background(), apiKeyContextKey{}, "a")
+	reqA, _ := http.NewRequestWithContext(ctxA, http.MethodGet, "http://example.test", nil)
+	ctxB := context.WithValue(context.Background(), apiKeyContextKey{}, "b")
+	reqB, _ := http.NewRequestWithContext(ctxB, http.MethodGet, "http://example.test", nil)
+
+	if _, err := rt(reqA); err == nil {
+		t.Fatal("expected reqA to fail")
+	}
+	if _, err := rt(reqA); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected api \"a\" circuit to be open, got %v", err)
+	}
+	if _, err := rt(reqB); errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("api \"b\" circuit should be unaffected by api \"a\" tripping")
+	}
+}
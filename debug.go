@@ -0,0 +1,119 @@
+package service_proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// defaultMaxDumpBytes bounds how much of a request/response body gets logged when Debug is on.
+const defaultMaxDumpBytes = 4096
+
+func defaultLogger(format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
+
+// peekRequestBody reads req.Body without consuming it, restoring it via a fresh reader
+// afterwards so the real send still sees the full body. It returns a nil slice without reading
+// anything when the body is multipart/form-data or is already known (via ContentLength) to be
+// bigger than maxDumpBytes, since dumpRequest suppresses/truncates those bodies anyway and
+// buffering a large upload into memory just to discard it is wasteful.
+func peekRequestBody(req *http.Request, maxDumpBytes int) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data") {
+		return nil, nil
+	}
+	if req.ContentLength > int64(maxDumpBytes) {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = req.Body.Close()
+
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+// peekResponseBody is the response counterpart to peekRequestBody.
+func peekResponseBody(res *http.Response) ([]byte, error) {
+	if res == nil || res.Body == nil {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = res.Body.Close()
+
+	res.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+// dumpRequest renders req and bodySnapshot for logging, suppressing the body when it is
+// multipart/form-data (file parts aren't useful in a log) or larger than maxDumpBytes.
+func dumpRequest(req *http.Request, bodySnapshot []byte, maxDumpBytes int) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s %s\n", req.Method, req.URL.String())
+	for key, vals := range req.Header {
+		for _, v := range vals {
+			fmt.Fprintf(&b, "%s: %s\n", key, v)
+		}
+	}
+
+	if req.Body != nil && bodySnapshot == nil {
+		if strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/form-data") {
+			fmt.Fprintf(&b, "\n<multipart form data omitted>")
+		} else {
+			fmt.Fprintf(&b, "\n<%d byte body omitted>", req.ContentLength)
+		}
+		return b.String()
+	}
+
+	if len(bodySnapshot) == 0 {
+		return b.String()
+	}
+
+	if len(bodySnapshot) > maxDumpBytes {
+		fmt.Fprintf(&b, "\n%s... <%d more bytes omitted>", bodySnapshot[:maxDumpBytes], len(bodySnapshot)-maxDumpBytes)
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "\n%s", bodySnapshot)
+	return b.String()
+}
+
+// dumpResponse renders res and its already-read body for logging, truncating the body at
+// maxDumpBytes.
+func dumpResponse(res *http.Response, body []byte, maxDumpBytes int) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s\n", res.Status)
+	for key, vals := range res.Header {
+		for _, v := range vals {
+			fmt.Fprintf(&b, "%s: %s\n", key, v)
+		}
+	}
+
+	if len(body) == 0 {
+		return b.String()
+	}
+
+	if len(body) > maxDumpBytes {
+		fmt.Fprintf(&b, "\n%s... <%d more bytes omitted>", body[:maxDumpBytes], len(body)-maxDumpBytes)
+		return b.String()
+	}
+
+	fmt.Fprintf(&b, "\n%s", body)
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package service_proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPeekRequestBodySkipsMultipart(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "http://example.test", bytes.NewReader([]byte("--boundary--")))
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=boundary")
+	req.ContentLength = 12
+
+	snapshot, err := peekRequestBody(req, defaultMaxDumpBytes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if snapshot != nil {
+		t.Fatalf("expected a nil snapshot for a multipart body, got %q", snapshot)
+	}
+
+	dump := dumpRequest(req, snapshot, defaultMaxDumpBytes)
+	if !strings.Contains(dump, "multipart form data omitted") {
+		t.Fatalf("expected the dump to note the omitted multipart body, got %q", dump)
+	}
+
+	// The body must still be intact for the real send.
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatalf("unexpected error reading body: %v", err)
+	}
+	if string(data) != "--boundary--" {
+		t.Fatalf("expected the body to survive the peek untouched, got %q", data)
+	}
+}
+
+func TestPeekRequestBodySkipsOversizedBody(t *testing.T) {
+	body := strings.Repeat("x", 10)
+	req, err := http.NewRequest(http.MethodPost, "http://example.test", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	req.ContentLength = int64(len(body))
+
+	snapshot, err := peekRequestBody(req, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if snapshot != nil {
+		t.Fatalf("expected a nil snapshot for a body over maxDumpBytes, got %q", snapshot)
+	}
+
+	dump := dumpRequest(req, snapshot, 4)
+	if !strings.Contains(dump, "10 byte body omitted") {
+		t.Fatalf("expected the dump to note the omitted oversized body, got %q", dump)
+	}
+}
+
+func TestPeekRequestBodyReadsSmallBody(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "http://example.test", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	req.ContentLength = 5
+
+	snapshot, err := peekRequestBody(req, defaultMaxDumpBytes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(snapshot) != "hello" {
+		t.Fatalf("expected snapshot %q, got %q", "hello", snapshot)
+	}
+
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatalf("unexpected error reading body: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("expected the body to survive the peek untouched, got %q", data)
+	}
+}
@@ -0,0 +1,37 @@
+package service_proxy
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ResponseDecoder decodes a response body into v.
+type ResponseDecoder interface {
+	Decode(data []byte, v interface{}) error
+}
+
+type jsonDecoder struct{}
+
+func (jsonDecoder) Decode(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type xmlDecoder struct{}
+
+func (xmlDecoder) Decode(data []byte, v interface{}) error {
+	return xml.Unmarshal(data, v)
+}
+
+type protobufDecoder struct{}
+
+func (protobufDecoder) Decode(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return errors.New(fmt.Sprintf("protobuf decode target must implement proto.Message, got %T", v))
+	}
+	return proto.Unmarshal(data, msg)
+}
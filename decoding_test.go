@@ -0,0 +1,27 @@
+package service_proxy
+
+import "testing"
+
+func TestJSONDecoder(t *testing.T) {
+	var out struct {
+		Name string `json:"name"`
+	}
+	if err := (jsonDecoder{}).Decode([]byte(`{"name":"ok"}`), &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.Name != "ok" {
+		t.Fatalf("expected Name %q, got %q", "ok", out.Name)
+	}
+}
+
+func TestXMLDecoder(t *testing.T) {
+	var out struct {
+		Name string `xml:"name"`
+	}
+	if err := (xmlDecoder{}).Decode([]byte(`<root><name>ok</name></root>`), &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.Name != "ok" {
+		t.Fatalf("expected Name %q, got %q", "ok", out.Name)
+	}
+}
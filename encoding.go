@@ -0,0 +1,169 @@
+package service_proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	BodyFormatRaw       = "raw"
+	BodyFormatJSON      = "json"
+	BodyFormatXML       = "xml"
+	BodyFormatForm      = "form"
+	BodyFormatMultipart = "multipart"
+	BodyFormatProtobuf  = "protobuf"
+)
+
+// BodyEncoder encodes v into a request body, returning the reader to stream it from, the
+// Content-Type it should be sent with (empty to leave the header untouched) and, when known,
+// its length (-1 when it cannot be determined up front).
+type BodyEncoder interface {
+	Encode(v interface{}) (body io.Reader, contentType string, length int64, err error)
+}
+
+// rawEncoder is the default encoder: string and []byte values are sent as-is, map[string]string
+// values are form-encoded and struct values are JSON-encoded, with no explicit BodyFormat required.
+type rawEncoder struct{}
+
+func (rawEncoder) Encode(v interface{}) (io.Reader, string, int64, error) {
+	// string
+	if str, ok := v.(string); ok {
+		return strings.NewReader(str), "", int64(len(str)), nil
+	}
+
+	// []byte
+	if b, ok := v.([]byte); ok {
+		return bytes.NewReader(b), "", int64(len(b)), nil
+	}
+
+	// map[string]string
+	if m, ok := v.(map[string]string); ok {
+		return (formEncoder{}).Encode(m)
+	}
+
+	// struct
+	rv := reflect.TypeOf(v)
+	if rv != nil && rv.Kind() == reflect.Struct {
+		return (jsonEncoder{}).Encode(v)
+	}
+
+	return nil, "", 0, errors.New(fmt.Sprintf("Illegal the body type: only string, []byte, map[string]string, struct supported"))
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) Encode(v interface{}) (io.Reader, string, int64, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	return bytes.NewReader(data), "application/json", int64(len(data)), nil
+}
+
+type xmlEncoder struct{}
+
+func (xmlEncoder) Encode(v interface{}) (io.Reader, string, int64, error) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	return bytes.NewReader(data), "application/xml", int64(len(data)), nil
+}
+
+type formEncoder struct{}
+
+func (formEncoder) Encode(v interface{}) (io.Reader, string, int64, error) {
+	m, ok := v.(map[string]string)
+	if !ok {
+		return nil, "", 0, errors.New(fmt.Sprintf("form body must be map[string]string, got %T", v))
+	}
+
+	form := url.Values{}
+	for key, val := range m {
+		form.Set(key, val)
+	}
+	encoded := form.Encode()
+
+	return strings.NewReader(encoded), "application/x-www-form-urlencoded", int64(len(encoded)), nil
+}
+
+// multipartEncoder accepts a map[string]interface{}. []byte, io.Reader and *os.File values
+// become file parts; everything else is written as a plain form field via fmt.Sprintf("%v").
+type multipartEncoder struct{}
+
+func (multipartEncoder) Encode(v interface{}) (io.Reader, string, int64, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, "", 0, errors.New(fmt.Sprintf("multipart body must be map[string]interface{}, got %T", v))
+	}
+
+	buf := &bytes.Buffer{}
+	writer := multipart.NewWriter(buf)
+
+	for field, val := range m {
+		switch fv := val.(type) {
+		case []byte:
+			part, err := writer.CreateFormFile(field, field)
+			if err != nil {
+				return nil, "", 0, err
+			}
+			if _, err = part.Write(fv); err != nil {
+				return nil, "", 0, err
+			}
+		case *os.File:
+			part, err := writer.CreateFormFile(field, filepath.Base(fv.Name()))
+			if err != nil {
+				return nil, "", 0, err
+			}
+			if _, err = io.Copy(part, fv); err != nil {
+				return nil, "", 0, err
+			}
+		case io.Reader:
+			part, err := writer.CreateFormFile(field, field)
+			if err != nil {
+				return nil, "", 0, err
+			}
+			if _, err = io.Copy(part, fv); err != nil {
+				return nil, "", 0, err
+			}
+		default:
+			if err := writer.WriteField(field, fmt.Sprintf("%v", fv)); err != nil {
+				return nil, "", 0, err
+			}
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", 0, err
+	}
+
+	return buf, writer.FormDataContentType(), int64(buf.Len()), nil
+}
+
+type protobufEncoder struct{}
+
+func (protobufEncoder) Encode(v interface{}) (io.Reader, string, int64, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, "", 0, errors.New(fmt.Sprintf("protobuf body must implement proto.Message, got %T", v))
+	}
+
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, "", 0, err
+	}
+
+	return bytes.NewReader(data), "application/x-protobuf", int64(len(data)), nil
+}
@@ -0,0 +1,185 @@
+package service_proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestRawEncoderTypes(t *testing.T) {
+	cases := []struct {
+		name string
+		in   interface{}
+		want string
+	}{
+		{"string", "hello", "hello"},
+		{"bytes", []byte("hello"), "hello"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			body, contentType, length, err := (rawEncoder{}).Encode(c.in)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if contentType != "" {
+				t.Fatalf("expected no Content-Type override, got %q", contentType)
+			}
+			data, err := ioutil.ReadAll(body)
+			if err != nil {
+				t.Fatalf("unexpected error reading body: %v", err)
+			}
+			if string(data) != c.want {
+				t.Fatalf("expected body %q, got %q", c.want, data)
+			}
+			if length != int64(len(c.want)) {
+				t.Fatalf("expected length %d, got %d", len(c.want), length)
+			}
+		})
+	}
+}
+
+func TestRawEncoderRejectsUnsupportedType(t *testing.T) {
+	if _, _, _, err := (rawEncoder{}).Encode(42); err == nil {
+		t.Fatal("expected an error for an unsupported body type")
+	}
+}
+
+func TestMultipartEncoderFilePartsAndFields(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "upload-*.txt")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.WriteString("from a file"); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+	if _, err = tmp.Seek(0, 0); err != nil {
+		t.Fatalf("failed to rewind temp file: %v", err)
+	}
+	defer tmp.Close()
+
+	body, contentType, length, err := (multipartEncoder{}).Encode(map[string]interface{}{
+		"bytesField": []byte("from bytes"),
+		"fileField":  tmp,
+		"textField":  "plain value",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatalf("unexpected error reading body: %v", err)
+	}
+	if length != int64(len(data)) {
+		t.Fatalf("expected length %d to match body size %d", length, len(data))
+	}
+
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatalf("unexpected error parsing Content-Type %q: %v", contentType, err)
+	}
+
+	mr := multipart.NewReader(bytes.NewReader(data), params["boundary"])
+	got := map[string]string{}
+	filenames := map[string]string{}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		partData, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatalf("unexpected error reading part %q: %v", part.FormName(), err)
+		}
+		got[part.FormName()] = string(partData)
+		filenames[part.FormName()] = part.FileName()
+	}
+
+	if got["bytesField"] != "from bytes" {
+		t.Fatalf("expected bytesField %q, got %q", "from bytes", got["bytesField"])
+	}
+	if filenames["bytesField"] == "" {
+		t.Fatal("expected bytesField to be sent as a file part")
+	}
+	if got["fileField"] != "from a file" {
+		t.Fatalf("expected fileField %q, got %q", "from a file", got["fileField"])
+	}
+	if !strings.HasSuffix(filenames["fileField"], ".txt") {
+		t.Fatalf("expected fileField's filename to come from the *os.File, got %q", filenames["fileField"])
+	}
+	if got["textField"] != "plain value" {
+		t.Fatalf("expected textField %q, got %q", "plain value", got["textField"])
+	}
+	if filenames["textField"] != "" {
+		t.Fatal("expected textField to be sent as a plain form field, not a file part")
+	}
+}
+
+func TestMultipartEncoderRejectsNonMap(t *testing.T) {
+	if _, _, _, err := (multipartEncoder{}).Encode("not a map"); err == nil {
+		t.Fatal("expected an error for a non-map body")
+	}
+}
+
+func TestFormEncoder(t *testing.T) {
+	body, contentType, _, err := (formEncoder{}).Encode(map[string]string{"a": "1", "b": "2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if contentType != "application/x-www-form-urlencoded" {
+		t.Fatalf("unexpected content type: %q", contentType)
+	}
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatalf("unexpected error reading body: %v", err)
+	}
+
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		t.Fatalf("unexpected error parsing form body: %v", err)
+	}
+	if values.Get("a") != "1" || values.Get("b") != "2" {
+		t.Fatalf("unexpected form values: %v", values)
+	}
+}
+
+func TestProtobufEncodeDecodeRoundTrip(t *testing.T) {
+	in := wrapperspb.String("round trip")
+
+	body, contentType, _, err := (protobufEncoder{}).Encode(in)
+	if err != nil {
+		t.Fatalf("unexpected error encoding: %v", err)
+	}
+	if contentType != "application/x-protobuf" {
+		t.Fatalf("unexpected content type: %q", contentType)
+	}
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatalf("unexpected error reading body: %v", err)
+	}
+
+	out := &wrapperspb.StringValue{}
+	if err = (protobufDecoder{}).Decode(data, out); err != nil {
+		t.Fatalf("unexpected error decoding: %v", err)
+	}
+	if out.Value != in.Value {
+		t.Fatalf("expected %q, got %q", in.Value, out.Value)
+	}
+}
+
+func TestProtobufEncoderRejectsNonProtoMessage(t *testing.T) {
+	if _, _, _, err := (protobufEncoder{}).Encode("not a proto message"); err == nil {
+		t.Fatal("expected an error for a non-proto.Message body")
+	}
+}
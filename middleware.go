@@ -0,0 +1,35 @@
+package service_proxy
+
+import (
+	"context"
+	"net/http"
+)
+
+// RoundTripFunc performs a single HTTP round trip, mirroring http.Client.Do's signature so
+// Middleware can wrap either the real client or another Middleware.
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// Middleware wraps a RoundTripFunc with cross-cutting behaviour (auth, rate limiting, metrics,
+// caching, circuit breaking, ...) and returns the wrapped RoundTripFunc.
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
+// chainMiddlewares wraps base with middlewares so that middlewares[0] runs first (outermost) and
+// base runs last (innermost).
+func chainMiddlewares(base RoundTripFunc, middlewares []Middleware) RoundTripFunc {
+	rt := base
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		rt = middlewares[i](rt)
+	}
+	return rt
+}
+
+// apiKeyContextKey is the context key RequestCtx attaches the RequestOptions.ApiKey under, so
+// middlewares such as the circuit breaker can key per-API state off it.
+type apiKeyContextKey struct{}
+
+// ApiKeyFromContext returns the RequestOptions.ApiKey a middleware's request was built from, if
+// any.
+func ApiKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(string)
+	return key, ok
+}
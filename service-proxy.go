@@ -2,25 +2,53 @@ package service_proxy
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
-	"reflect"
-	"strings"
+	"time"
 )
 
 type ServiceApi struct {
 	Method string
 	Path   string
+
+	// RequestFormat is the default RequestOptions.BodyFormat for calls against this API when
+	// the caller does not set one explicitly.
+	RequestFormat string
+	// ResponseFormat is the ResponseDecoder key Decode uses for calls against this API.
+	// Defaults to "json" when empty.
+	ResponseFormat string
+
+	// PathParams names the {param} placeholders in Path that RequestOptions.PathParams must
+	// supply.
+	PathParams []string
+	// PathParamPatterns optionally validates a PathParams value against a regexp, keyed by
+	// param name.
+	PathParamPatterns map[string]string
+
+	// DefaultQuery and DefaultHeaders are merged under RequestOptions.Query/Headers at call
+	// time, with the RequestOptions values taking precedence on key conflicts.
+	DefaultQuery   map[string]string
+	DefaultHeaders map[string]string
 }
 
 type HTTPServiceProxy struct {
-	url          *url.URL
-	preprocessor func(*http.Request) // 请求预处理器，用于统一添加请求头等操作
-	apis         map[string]ServiceApi
+	url             *url.URL
+	apis            map[string]ServiceApi
+	client          *http.Client
+	maxRetries      int
+	retryBackoff    func(attempt int) time.Duration
+	retryableStatus func(statusCode int) bool
+	encoders        map[string]BodyEncoder
+	decoders        map[string]ResponseDecoder
+	roundTrip       RoundTripFunc
 }
 
 type HTTPServiceProxyOptions struct {
@@ -28,6 +56,43 @@ type HTTPServiceProxyOptions struct {
 	Host         string
 	Preprocessor func(*http.Request)
 	APIs         map[string]ServiceApi
+
+	// Timeout is applied to the shared http.Client. Defaults to 30s when unset.
+	Timeout time.Duration
+	// MaxRetries is the number of additional attempts after the first one fails.
+	MaxRetries int
+	// RetryBackoff computes the delay before the given retry attempt (0-based). Defaults to
+	// exponential backoff with jitter.
+	RetryBackoff func(attempt int) time.Duration
+	// RetryableStatus decides whether a response status code should be retried. Defaults to
+	// 429/502/503/504.
+	RetryableStatus func(statusCode int) bool
+
+	// Encoders registers additional BodyEncoder implementations, or overrides the built-in
+	// ones, keyed by the same names used for RequestOptions.BodyFormat / ServiceApi.RequestFormat.
+	Encoders map[string]BodyEncoder
+	// Decoders registers additional ResponseDecoder implementations, or overrides the built-in
+	// ones, keyed by the same names used for ServiceApi.ResponseFormat.
+	Decoders map[string]ResponseDecoder
+
+	// Debug, when true, makes RawRequest dump every outgoing request and incoming response
+	// through Logger.
+	Debug bool
+	// Logger receives the debug dumps. Defaults to log.Printf.
+	Logger func(format string, args ...interface{})
+	// MaxDumpBytes caps how much of a request/response body Debug logging includes. Defaults
+	// to 4096.
+	MaxDumpBytes int
+	// OnBeforeRequest, when set, is invoked with the outgoing *http.Request on every attempt,
+	// regardless of Debug. Useful for wiring in tracing/metrics.
+	OnBeforeRequest func(*http.Request)
+	// OnAfterResponse, when set, is invoked after every attempt with the request, response (nil
+	// on transport error), elapsed time and error, regardless of Debug.
+	OnAfterResponse func(req *http.Request, res *http.Response, elapsed time.Duration, err error)
+
+	// Middlewares wraps the underlying client.Do call, outermost first. The Preprocessor, if
+	// any, always runs as the very first middleware, ahead of these.
+	Middlewares []Middleware
 }
 
 type RequestOptions struct {
@@ -35,6 +100,29 @@ type RequestOptions struct {
 	Query   map[string]string
 	Body    interface{} // []byte, string, map[string]string, struct
 	Headers map[string]string
+	// Context, when set, is used by Request in place of context.Background(). RequestCtx takes
+	// an explicit context instead and ignores this field.
+	Context context.Context
+	// BodyFormat selects the BodyEncoder used to encode Body, e.g. "json", "xml", "form",
+	// "multipart", "protobuf", "raw". Defaults to ServiceApi.RequestFormat, then to "raw".
+	BodyFormat string
+	// PathParams supplies the values for the ServiceApi.PathParams placeholders in its Path.
+	PathParams map[string]string
+}
+
+func defaultRetryBackoff(attempt int) time.Duration {
+	base := time.Duration(1<<uint(attempt)) * 100 * time.Millisecond
+	jitter := time.Duration(rand.Int63n(int64(base)/2 + 1))
+	return base + jitter
+}
+
+func defaultRetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
 }
 
 func NewHTTPServiceProxy(opts HTTPServiceProxyOptions) *HTTPServiceProxy {
@@ -46,13 +134,115 @@ func NewHTTPServiceProxy(opts HTTPServiceProxyOptions) *HTTPServiceProxy {
 		}
 	}
 
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	retryBackoff := opts.RetryBackoff
+	if retryBackoff == nil {
+		retryBackoff = defaultRetryBackoff
+	}
+
+	retryableStatus := opts.RetryableStatus
+	if retryableStatus == nil {
+		retryableStatus = defaultRetryableStatus
+	}
+
+	encoders := map[string]BodyEncoder{
+		BodyFormatRaw:       rawEncoder{},
+		BodyFormatJSON:      jsonEncoder{},
+		BodyFormatXML:       xmlEncoder{},
+		BodyFormatForm:      formEncoder{},
+		BodyFormatMultipart: multipartEncoder{},
+		BodyFormatProtobuf:  protobufEncoder{},
+	}
+	for key, enc := range opts.Encoders {
+		encoders[key] = enc
+	}
+
+	decoders := map[string]ResponseDecoder{
+		BodyFormatJSON:     jsonDecoder{},
+		BodyFormatXML:      xmlDecoder{},
+		BodyFormatProtobuf: protobufDecoder{},
+	}
+	for key, dec := range opts.Decoders {
+		decoders[key] = dec
+	}
+
+	logger := opts.Logger
+	if logger == nil {
+		logger = defaultLogger
+	}
+
+	maxDumpBytes := opts.MaxDumpBytes
+	if maxDumpBytes <= 0 {
+		maxDumpBytes = defaultMaxDumpBytes
+	}
+
+	client := &http.Client{Timeout: timeout}
+
+	debug := opts.Debug
+	onBeforeRequest := opts.OnBeforeRequest
+	onAfterResponse := opts.OnAfterResponse
+
+	// instrumentedDo is the innermost round tripper: it performs the real client.Do call and
+	// carries the debug dump / hook behaviour, so it always sees the request exactly as it goes
+	// out on the wire and the response exactly as it comes back, regardless of what the
+	// middlewares above it do.
+	instrumentedDo := RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if debug {
+			bodySnapshot, _ := peekRequestBody(req, maxDumpBytes)
+			logger("service-proxy: request\n%s", dumpRequest(req, bodySnapshot, maxDumpBytes))
+		}
+		if onBeforeRequest != nil {
+			onBeforeRequest(req)
+		}
+
+		start := time.Now()
+		res, err := client.Do(req)
+		elapsed := time.Since(start)
+
+		if onAfterResponse != nil {
+			onAfterResponse(req, res, elapsed, err)
+		}
+		if debug {
+			if err != nil {
+				logger("service-proxy: response error (%s): %v", req.URL.String(), err)
+			} else {
+				respBody, _ := peekResponseBody(res)
+				logger("service-proxy: response\n%s", dumpResponse(res, respBody, maxDumpBytes))
+			}
+		}
+
+		return res, err
+	})
+
+	preprocessor := opts.Preprocessor
+	preprocessorMiddleware := Middleware(func(next RoundTripFunc) RoundTripFunc {
+		return func(req *http.Request) (*http.Response, error) {
+			if preprocessor != nil {
+				preprocessor(req)
+			}
+			return next(req)
+		}
+	})
+
+	middlewares := append([]Middleware{preprocessorMiddleware}, opts.Middlewares...)
+
 	return &HTTPServiceProxy{
 		url: &url.URL{
 			Scheme: opts.Scheme,
 			Host:   opts.Host,
 		},
-		preprocessor: opts.Preprocessor,
-		apis:         apis,
+		apis:            apis,
+		client:          client,
+		maxRetries:      opts.MaxRetries,
+		retryBackoff:    retryBackoff,
+		retryableStatus: retryableStatus,
+		encoders:        encoders,
+		decoders:        decoders,
+		roundTrip:       chainMiddlewares(instrumentedDo, middlewares),
 	}
 }
 
@@ -77,17 +267,61 @@ func (p *HTTPServiceProxy) getUrlStr(path string, query map[string]string) strin
 	return p.getUrl(path, query).String()
 }
 
+// RawRequest sends req through p.roundTrip (the preprocessor and any configured Middlewares,
+// wrapping the shared client), retrying on transport errors and on the statuses
+// p.retryableStatus reports as retryable. The request's own context governs cancellation of
+// both the call and the inter-attempt backoff sleep. Any request body is buffered up front so it
+// can be replayed on each attempt.
 func (p *HTTPServiceProxy) RawRequest(req *http.Request) (result []byte, err error) {
 	var (
-		res *http.Response
+		res      *http.Response
+		respBody []byte
 	)
-	client := &http.Client{}
 
-	if p.preprocessor != nil {
-		p.preprocessor(req)
+	ctx := req.Context()
+
+	var bodySnapshot []byte
+	if req.Body != nil {
+		bodySnapshot, err = ioutil.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			err = errors.New(fmt.Sprintf("Failed to buffer request body (%s): %v", req.URL.String(), err))
+			return
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		if bodySnapshot != nil {
+			req.Body = ioutil.NopCloser(bytes.NewReader(bodySnapshot))
+			req.ContentLength = int64(len(bodySnapshot))
+		}
+
+		res, err = p.roundTrip(req)
+
+		respBody = nil
+		if err == nil {
+			respBody, err = ioutil.ReadAll(res.Body)
+			_ = res.Body.Close()
+		}
+
+		retryable := false
+		if err != nil {
+			retryable = !errors.Is(err, ErrCircuitOpen) && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+		} else if p.retryableStatus(res.StatusCode) {
+			retryable = true
+		}
+
+		if !retryable || attempt >= p.maxRetries {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(p.retryBackoff(attempt)):
+		}
 	}
 
-	res, err = client.Do(req)
 	if err != nil {
 		err = errors.New(fmt.Sprintf("Failed to request (%s): %v", req.URL.String(), err))
 		return
@@ -98,15 +332,7 @@ func (p *HTTPServiceProxy) RawRequest(req *http.Request) (result []byte, err err
 		return
 	}
 
-	result, err = ioutil.ReadAll(res.Body)
-	if err != nil {
-		err = errors.New(fmt.Sprintf("Failed to read response body from %s: %v", req.URL.String(), err))
-		return
-	}
-	defer func() {
-		_ = res.Body.Close()
-	}()
-
+	result = respBody
 	return
 }
 
@@ -122,37 +348,79 @@ func (p *HTTPServiceProxy) getApi(key string) *ServiceApi {
 }
 
 func (p *HTTPServiceProxy) Request(opts *RequestOptions) (result []byte, err error) {
-	var (
-		req *http.Request
-		//body *bytes.Reader
-	)
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return p.RequestCtx(ctx, opts)
+}
+
+// RequestCtx is equivalent to Request but takes an explicit context, which is attached to the
+// underlying http.Request and governs both the call and any retry backoff.
+func (p *HTTPServiceProxy) RequestCtx(ctx context.Context, opts *RequestOptions) (result []byte, err error) {
+	var req *http.Request
 
 	api := p.getApi(opts.ApiKey)
 	if api == nil {
 		return nil, errors.New(fmt.Sprintf("Invalid API key: %s", opts.ApiKey))
 	}
 
-	/* if opts.Body != nil {
-		body = bytes.NewReader(opts.Body)
-	} */
+	ctx = context.WithValue(ctx, apiKeyContextKey{}, opts.ApiKey)
 
-	req, err = http.NewRequest(api.Method, p.getUrlStr(api.Path, opts.Query), nil)
+	path := api.Path
+	if len(api.PathParams) > 0 || len(opts.PathParams) > 0 {
+		if err = validatePathParams(api, opts.PathParams); err != nil {
+			return nil, err
+		}
+		path = expandPathParams(path, opts.PathParams)
+	}
+
+	query := mergeStringMaps(api.DefaultQuery, opts.Query)
+
+	req, err = http.NewRequestWithContext(ctx, api.Method, p.getUrlStr(path, query), nil)
 	if err != nil {
 		return nil, err
 	}
 
 	header := make(http.Header)
-	if opts.Headers != nil {
-		for key, val := range opts.Headers {
-			header.Set(key, val)
-		}
+	for key, val := range mergeStringMaps(api.DefaultHeaders, opts.Headers) {
+		header.Set(key, val)
 	}
 	req.Header = header
 
 	if opts.Body != nil {
-		err = processBody(req, opts.Body)
-		if err != nil {
-			return nil, err
+		format := opts.BodyFormat
+		if format == "" {
+			format = api.RequestFormat
+		}
+		if format == "" {
+			format = BodyFormatRaw
+		}
+
+		encoder, ok := p.encoders[format]
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("Unknown request body format: %s", format))
+		}
+
+		body, contentType, length, encErr := encoder.Encode(opts.Body)
+		if encErr != nil {
+			return nil, encErr
+		}
+
+		// Buffer the encoded body so req.GetBody can replay it: middlewares (e.g. the bearer
+		// token middleware retrying after a 401) may need to resend req after the first attempt
+		// already drained it.
+		bodyBytes, readErr := ioutil.ReadAll(body)
+		if readErr != nil {
+			return nil, readErr
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(bodyBytes))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(bodyBytes)), nil
+		}
+		req.ContentLength = length
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
 		}
 	}
 
@@ -168,48 +436,33 @@ func (p *HTTPServiceProxy) JSON(opts *RequestOptions, result interface{}) error
 	return json.Unmarshal(data, result)
 }
 
-func processBody(req *http.Request, body interface{}) error {
-	// string
-	if str, ok := body.(string); ok {
-		req.Body = ioutil.NopCloser(strings.NewReader(str))
-		req.ContentLength = int64(len(str))
-		return nil
-	}
-
-	// []byte
-	if b, ok := body.([]byte); ok {
-		req.Body = ioutil.NopCloser(bytes.NewReader(b))
-		req.ContentLength = int64(len(b))
-		return nil
+// XML is the XML counterpart to JSON.
+func (p *HTTPServiceProxy) XML(opts *RequestOptions, result interface{}) error {
+	data, err := p.Request(opts)
+	if err != nil {
+		return err
 	}
 
-	// map[string]string
-	if m, ok := body.(map[string]string); ok {
-		err := req.ParseForm()
-		if err != nil {
-			return nil
-		}
-		for key, val := range m {
-			req.Form.Add(key, val)
-		}
+	return xml.Unmarshal(data, result)
+}
 
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-		return nil
+// Decode requests opts and decodes the response with the ResponseDecoder registered for
+// ServiceApi.ResponseFormat, defaulting to "json" when the API declares none.
+func (p *HTTPServiceProxy) Decode(opts *RequestOptions, result interface{}) error {
+	data, err := p.Request(opts)
+	if err != nil {
+		return err
 	}
 
-	// struct
-	rBody := reflect.TypeOf(body)
-	if rBody.Kind().String() == "struct" {
-		b, err := json.Marshal(body)
-		if err != nil {
-			return err
-		}
+	format := BodyFormatJSON
+	if api := p.getApi(opts.ApiKey); api != nil && api.ResponseFormat != "" {
+		format = api.ResponseFormat
+	}
 
-		req.Body = ioutil.NopCloser(bytes.NewReader(b))
-		req.ContentLength = int64(len(b))
-		req.Header.Set("Content-Type", "application/json")
-		return nil
-	} else {
-		return errors.New(fmt.Sprintf("Illegal the body type: only string, []byte, map[string]string, struct supported"))
+	decoder, ok := p.decoders[format]
+	if !ok {
+		return errors.New(fmt.Sprintf("Unknown response format: %s", format))
 	}
+
+	return decoder.Decode(data, result)
 }
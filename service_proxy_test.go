@@ -0,0 +1,230 @@
+package service_proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestProxy(t *testing.T, server *httptest.Server, apis map[string]ServiceApi, maxRetries int) *HTTPServiceProxy {
+	t.Helper()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("failed to parse test server URL: %v", err)
+	}
+
+	return NewHTTPServiceProxy(HTTPServiceProxyOptions{
+		Scheme:       u.Scheme,
+		Host:         u.Host,
+		APIs:         apis,
+		MaxRetries:   maxRetries,
+		RetryBackoff: func(attempt int) time.Duration { return time.Millisecond },
+	})
+}
+
+func TestRawRequestRetriesOnRetryableStatus(t *testing.T) {
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&attempts, 1)
+		if n < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	p := newTestProxy(t, server, map[string]ServiceApi{"ping": {Method: http.MethodGet, Path: "/ping"}}, 2)
+
+	result, err := p.Request(&RequestOptions{ApiKey: "ping"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(result) != "ok" {
+		t.Fatalf("unexpected result: %q", result)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Fatalf("expected 3 attempts, got %d", got)
+	}
+}
+
+func TestRawRequestDoesNotRetryNonRetryableStatus(t *testing.T) {
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	p := newTestProxy(t, server, map[string]ServiceApi{"ping": {Method: http.MethodGet, Path: "/ping"}}, 2)
+
+	_, err := p.Request(&RequestOptions{ApiKey: "ping"})
+	if err == nil {
+		t.Fatal("expected an error for a non-2xx response")
+	}
+	if got := atomic.LoadInt32(&attempts); got != 1 {
+		t.Fatalf("expected 1 attempt, got %d", got)
+	}
+}
+
+func TestRawRequestDoesNotRetryOpenCircuit(t *testing.T) {
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("failed to parse test server URL: %v", err)
+	}
+
+	p := NewHTTPServiceProxy(HTTPServiceProxyOptions{
+		Scheme:       u.Scheme,
+		Host:         u.Host,
+		APIs:         map[string]ServiceApi{"ping": {Method: http.MethodGet, Path: "/ping"}},
+		MaxRetries:   2,
+		RetryBackoff: func(attempt int) time.Duration { return time.Millisecond },
+		Middlewares:  []Middleware{NewCircuitBreaker(1, time.Hour)},
+	})
+
+	// First call trips the breaker (one underlying attempt, since MaxRetries only applies to
+	// retryable failures and the breaker itself isn't retried within a single RawRequest call
+	// once past threshold).
+	if _, err = p.Request(&RequestOptions{ApiKey: "ping"}); err == nil {
+		t.Fatal("expected an error from the first call")
+	}
+	tripped := atomic.LoadInt32(&attempts)
+
+	// Second call should short-circuit on the open breaker immediately, not burn the retry
+	// budget re-invoking the still-open breaker.
+	if _, err = p.Request(&RequestOptions{ApiKey: "ping"}); err == nil {
+		t.Fatal("expected an error from the open circuit")
+	}
+	if got := atomic.LoadInt32(&attempts); got != tripped {
+		t.Fatalf("expected no further attempts while circuit is open, went from %d to %d", tripped, got)
+	}
+}
+
+func TestHooksFirePerAttempt(t *testing.T) {
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&attempts, 1)
+		if n < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("failed to parse test server URL: %v", err)
+	}
+
+	var before, after int32
+	p := NewHTTPServiceProxy(HTTPServiceProxyOptions{
+		Scheme:       u.Scheme,
+		Host:         u.Host,
+		APIs:         map[string]ServiceApi{"ping": {Method: http.MethodGet, Path: "/ping"}},
+		MaxRetries:   2,
+		RetryBackoff: func(attempt int) time.Duration { return time.Millisecond },
+		OnBeforeRequest: func(req *http.Request) {
+			atomic.AddInt32(&before, 1)
+		},
+		OnAfterResponse: func(req *http.Request, res *http.Response, elapsed time.Duration, err error) {
+			atomic.AddInt32(&after, 1)
+		},
+	})
+
+	if _, err = p.Request(&RequestOptions{ApiKey: "ping"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Fatalf("expected 3 attempts, got %d", got)
+	}
+	if got := atomic.LoadInt32(&before); got != 3 {
+		t.Fatalf("expected OnBeforeRequest to fire 3 times, got %d", got)
+	}
+	if got := atomic.LoadInt32(&after); got != 3 {
+		t.Fatalf("expected OnAfterResponse to fire 3 times, got %d", got)
+	}
+}
+
+func TestRequestBodyFormatFallsBackToAPIThenRaw(t *testing.T) {
+	var gotContentType string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotContentType = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("failed to parse test server URL: %v", err)
+	}
+
+	apis := map[string]ServiceApi{
+		"withFormat":    {Method: http.MethodPost, Path: "/a", RequestFormat: BodyFormatJSON},
+		"withoutFormat": {Method: http.MethodPost, Path: "/b"},
+	}
+	p := NewHTTPServiceProxy(HTTPServiceProxyOptions{Scheme: u.Scheme, Host: u.Host, APIs: apis})
+
+	// No opts.BodyFormat set: falls back to the API's RequestFormat.
+	if _, err = p.Request(&RequestOptions{ApiKey: "withFormat", Body: map[string]string{"a": "1"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotContentType != "application/json" {
+		t.Fatalf("expected the API's RequestFormat to be used, got Content-Type %q", gotContentType)
+	}
+
+	// Neither opts.BodyFormat nor the API's RequestFormat is set: falls back to raw, which
+	// accepts a plain string with no Content-Type override.
+	if _, err = p.Request(&RequestOptions{ApiKey: "withoutFormat", Body: "plain body"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotContentType != "" {
+		t.Fatalf("expected the raw fallback to leave Content-Type unset, got %q", gotContentType)
+	}
+
+	// opts.BodyFormat takes precedence over the API's RequestFormat.
+	if _, err = p.Request(&RequestOptions{ApiKey: "withFormat", Body: "<a/>", BodyFormat: BodyFormatXML}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotContentType != "application/xml" {
+		t.Fatalf("expected opts.BodyFormat to override the API's RequestFormat, got %q", gotContentType)
+	}
+}
+
+func TestRawRequestGivesUpAfterMaxRetries(t *testing.T) {
+	var attempts int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	p := newTestProxy(t, server, map[string]ServiceApi{"ping": {Method: http.MethodGet, Path: "/ping"}}, 2)
+
+	_, err := p.Request(&RequestOptions{ApiKey: "ping"})
+	if err == nil {
+		t.Fatal("expected an error after exhausting retries")
+	}
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Fatalf("expected 1 initial attempt + 2 retries = 3, got %d", got)
+	}
+}